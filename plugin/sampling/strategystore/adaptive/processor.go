@@ -29,6 +29,10 @@ const (
 
 	// The number of past entries for samplingCache the leader keeps in memory
 	serviceCacheSize = 25
+
+	// metricsFloatScale scales float-valued gauges (probabilities, qps) up before recording
+	// them, since metrics.Gauge only carries int64 values.
+	metricsFloatScale = 1e6
 )
 
 var (
@@ -59,6 +63,24 @@ type Processor interface {
 
 	// Stop stops the processor from calculating probabilities.
 	Stop()
+
+	// Reconfigure atomically applies the given overrides, validating them against the same
+	// invariants enforced at construction time, and returns an error without changing
+	// anything if they would be violated.
+	Reconfigure(args ReconfigureArgs) error
+
+	// Config returns the processor's current effective configuration.
+	Config() ProcessorConfig
+}
+
+// ReconfigureArgs holds the optional runtime overrides accepted by Processor.Reconfigure.
+// A nil field leaves the corresponding value untouched.
+type ReconfigureArgs struct {
+	NewTargetQPS                  *float64
+	NewMinSamplingProbability     *float64
+	NewDefaultSamplingProbability *float64
+	NewCalculationInterval        *time.Duration
+	NewLookbackInterval           *time.Duration
 }
 
 type processor struct {
@@ -95,10 +117,19 @@ type processor struct {
 
 	logger *zap.Logger
 
-	weightsCache *weightsCache
+	qpsCalculator QPSCalculator
 
 	probabilityCalculator calculationstrategy.ProbabilityCalculator
 
+	// recalculationScheduler bounds per-tick probability recalculation work on deployments
+	// with very large numbers of operations. See RecalculationScheduler.
+	recalculationScheduler RecalculationScheduler
+
+	// calculationTicker is the ticker driving runCalculationLoop, kept on the processor so
+	// Reconfigure can Reset it when CalculationInterval changes instead of waiting for the
+	// process to restart.
+	calculationTicker Ticker
+
 	// followerProbabilityInterval determines how often the follower processor updates its probabilities.
 	// Given only the leader writes probabilities, the followers need to fetch the probabilities into
 	// cache.
@@ -106,8 +137,19 @@ type processor struct {
 
 	serviceCache []samplingCache
 
-	operationsCalculatedGauge     metrics.Gauge
-	calculateProbabilitiesLatency metrics.Timer
+	metricsFactory                  metrics.Factory
+	operationsCalculatedGauge       metrics.Gauge
+	calculateProbabilitiesLatency   metrics.Timer
+	leaderGauge                     metrics.Gauge
+	throughputFetchSuccessCounter   metrics.Counter
+	throughputFetchFailureCounter   metrics.Counter
+	throughputFetchLatency          metrics.Timer
+	lockAcquireSuccessCounter       metrics.Counter
+	lockAcquireFailureCounter       metrics.Counter
+	probabilitiesSavedCounter       metrics.Counter
+	probabilitiesSaveErrorCounter   metrics.Counter
+	omittedOperationsGauge          metrics.Gauge
+	probabilityChangeRatioHistogram metrics.Histogram
 }
 
 // NewProcessor creates a new sampling processor that generates sampling rates for service operations
@@ -133,7 +175,13 @@ func NewProcessor(
 	}
 	buckets := int(config.LookbackInterval / config.CalculationInterval)
 	metricsFactory = metricsFactory.Namespace("adaptive_sampling_processor", nil)
-	return &processor{
+	var qpsCalculator QPSCalculator
+	if config.EWMAHalfLife > 0 {
+		qpsCalculator = NewEWMAQPSCalculator(config.CalculationInterval, config.EWMAHalfLife)
+	} else {
+		qpsCalculator = newWeightedQPSCalculator(newWeightsCache())
+	}
+	p := &processor{
 		ProcessorConfig:   config,
 		storage:           storage,
 		buckets:           buckets,
@@ -143,14 +191,27 @@ func NewProcessor(
 		strategyResponses: make(map[string]*sampling.SamplingStrategyResponse),
 		logger:            logger,
 		lock:              lock,
-		// TODO make weightsCache and probabilityCalculator configurable
-		weightsCache:                  newWeightsCache(),
-		probabilityCalculator:         calculationstrategy.NewPercentageIncreaseCappedCalculator(1.0),
-		followerProbabilityInterval:   defaultFollowerProbabilityInterval,
-		serviceCache:                  []samplingCache{},
-		operationsCalculatedGauge:     metricsFactory.Gauge("operations_calculated", nil),
-		calculateProbabilitiesLatency: metricsFactory.Timer("calculate_probabilities", nil),
-	}, nil
+		// TODO make probabilityCalculator configurable
+		qpsCalculator:                   qpsCalculator,
+		probabilityCalculator:           calculationstrategy.NewPercentageIncreaseCappedCalculator(1.0),
+		followerProbabilityInterval:     defaultFollowerProbabilityInterval,
+		serviceCache:                    []samplingCache{},
+		metricsFactory:                  metricsFactory,
+		operationsCalculatedGauge:       metricsFactory.Gauge("operations_calculated", nil),
+		calculateProbabilitiesLatency:   metricsFactory.Timer("calculate_probabilities", nil),
+		leaderGauge:                     metricsFactory.Gauge("leader", nil),
+		throughputFetchSuccessCounter:   metricsFactory.Counter("throughput_fetch_success", nil),
+		throughputFetchFailureCounter:   metricsFactory.Counter("throughput_fetch_failure", nil),
+		throughputFetchLatency:          metricsFactory.Timer("throughput_fetch_latency", nil),
+		lockAcquireSuccessCounter:       metricsFactory.Counter("lock_acquire_success", nil),
+		lockAcquireFailureCounter:       metricsFactory.Counter("lock_acquire_failure", nil),
+		probabilitiesSavedCounter:       metricsFactory.Counter("probabilities_saved", nil),
+		probabilitiesSaveErrorCounter:   metricsFactory.Counter("probabilities_saved_errors", nil),
+		omittedOperationsGauge:          metricsFactory.Gauge("omitted_operations", nil),
+		probabilityChangeRatioHistogram: metricsFactory.Histogram("probability_change_ratio", nil),
+	}
+	p.recalculationScheduler = newPriorityQueueScheduler(p.Mutable.GetTargetQPS, config.MaxRecalculationStaleness)
+	return p, nil
 }
 
 func (p *processor) GetSamplingStrategyResponses(service string) sampling.SamplingStrategyResponse {
@@ -194,16 +255,107 @@ func (p *processor) loadProbabilities() {
 	p.probabilities = probabilities
 }
 
+// Reconfigure atomically applies the given overrides under the processor's write lock,
+// validating them against the same invariants enforced at construction time. If
+// CalculationInterval changed, it resets runCalculationLoop's ticker so the new cadence
+// applies before the next tick rather than after a restart. If the target QPS changed, it
+// also triggers an immediate recalculation on the leader, provided at least one throughput
+// bucket has been observed, so the change takes effect before the next CalculationInterval
+// tick.
+func (p *processor) Reconfigure(args ReconfigureArgs) error {
+	p.Lock()
+	newCalculationInterval := p.CalculationInterval
+	if args.NewCalculationInterval != nil {
+		newCalculationInterval = *args.NewCalculationInterval
+	}
+	newLookbackInterval := p.LookbackInterval
+	if args.NewLookbackInterval != nil {
+		newLookbackInterval = *args.NewLookbackInterval
+	}
+	if newCalculationInterval == 0 || newLookbackInterval == 0 {
+		p.Unlock()
+		return errNonZeroIntervals
+	}
+	if newLookbackInterval < newCalculationInterval {
+		p.Unlock()
+		return errIntervals
+	}
+
+	oldCalculationInterval := p.CalculationInterval
+	oldLookbackInterval := p.LookbackInterval
+	oldMinSamplingProbability := p.MinSamplingProbability
+	oldDefaultSamplingProbability := p.DefaultSamplingProbability
+	oldTargetQPS := p.Mutable.GetTargetQPS()
+
+	p.CalculationInterval = newCalculationInterval
+	p.LookbackInterval = newLookbackInterval
+	if args.NewMinSamplingProbability != nil {
+		p.MinSamplingProbability = *args.NewMinSamplingProbability
+	}
+	if args.NewDefaultSamplingProbability != nil {
+		p.DefaultSamplingProbability = *args.NewDefaultSamplingProbability
+	}
+	p.buckets = int(p.LookbackInterval / p.CalculationInterval)
+	if len(p.throughputs) > p.buckets {
+		p.throughputs = p.throughputs[0:p.buckets]
+	}
+	targetQPSChanged := args.NewTargetQPS != nil
+	if targetQPSChanged {
+		p.Mutable.SetTargetQPS(*args.NewTargetQPS)
+	}
+	calculationIntervalChanged := args.NewCalculationInterval != nil
+	hasThroughput := len(p.throughputs) > 0
+	ticker := p.calculationTicker
+	p.Unlock()
+
+	if calculationIntervalChanged && ticker != nil {
+		ticker.Reset(newCalculationInterval)
+	}
+
+	p.logger.Info("Reconfigured adaptive sampling processor",
+		zap.Duration("oldCalculationInterval", oldCalculationInterval),
+		zap.Duration("newCalculationInterval", newCalculationInterval),
+		zap.Duration("oldLookbackInterval", oldLookbackInterval),
+		zap.Duration("newLookbackInterval", newLookbackInterval),
+		zap.Float64("oldMinSamplingProbability", oldMinSamplingProbability),
+		zap.Float64("newMinSamplingProbability", p.MinSamplingProbability),
+		zap.Float64("oldDefaultSamplingProbability", oldDefaultSamplingProbability),
+		zap.Float64("newDefaultSamplingProbability", p.DefaultSamplingProbability),
+		zap.Float64("oldTargetQPS", oldTargetQPS),
+		zap.Float64("newTargetQPS", p.Mutable.GetTargetQPS()),
+	)
+
+	if targetQPSChanged && p.isLeader() && hasThroughput {
+		probabilities, qps := p.calculateProbabilitiesAndQPS()
+		p.Lock()
+		p.probabilities = probabilities
+		p.qps = qps
+		p.Unlock()
+		p.generateStrategyResponses()
+		go p.saveProbabilitiesAndQPS()
+	}
+	return nil
+}
+
+// Config returns the processor's current effective configuration.
+func (p *processor) Config() ProcessorConfig {
+	p.RLock()
+	defer p.RUnlock()
+	return p.ProcessorConfig
+}
+
 // runAcquireLockLoop attempts to acquire the leader lock. If it succeeds, it will attempt to retain it,
 // otherwise it sleeps and attempts to gain the lock again.
 func (p *processor) runAcquireLockLoop() {
-	addJitter(p.LeaderLeaseRefreshInterval)
-	ticker := time.NewTicker(p.acquireLock())
+	// Delay the first attempt so that a fleet of collectors restarting together doesn't all
+	// race for the leader lock in lockstep; retries after this are already spread out by the
+	// ticker's own jitter.
+	sleepJitter(p.LeaderLeaseRefreshInterval)
+	ticker := p.newIntervalTicker(p.acquireLock(), p.Jitter)
 	for {
 		select {
-		case <-ticker.C:
-			ticker.Stop()
-			ticker = time.NewTicker(p.acquireLock())
+		case <-ticker.C():
+			ticker.Reset(p.acquireLock())
 		case <-p.acquireLockStop:
 			ticker.Stop()
 			return
@@ -214,8 +366,10 @@ func (p *processor) runAcquireLockLoop() {
 // acquireLock attempts to acquire the lock and returns the interval to sleep before the next retry.
 func (p *processor) acquireLock() time.Duration {
 	if acquiredLeaderLock, err := p.lock.Acquire(samplingLock); err == nil {
+		p.lockAcquireSuccessCounter.Inc(1)
 		p.setLeader(acquiredLeaderLock)
 	} else {
+		p.lockAcquireFailureCounter.Inc(1)
 		p.logger.Error(acquireLockErrMsg, zap.Error(err))
 	}
 	if p.isLeader() {
@@ -230,12 +384,15 @@ func (p *processor) acquireLock() time.Duration {
 // runUpdateProbabilitiesLoop starts a loop that reads probabilities from storage.
 // The follower updates its local cache with the latest probabilities and serves them.
 func (p *processor) runUpdateProbabilitiesLoop() {
-	addJitter(p.followerProbabilityInterval)
-	ticker := time.NewTicker(p.followerProbabilityInterval)
+	// Delay the first reload so that a fleet of collectors restarting together doesn't all
+	// hit storage/cache in lockstep; see sleepJitter.
+	sleepJitter(p.followerProbabilityInterval)
+	ticker := p.newIntervalTicker(p.followerProbabilityInterval, p.Jitter)
 	defer ticker.Stop()
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
+			ticker.Reset(p.followerProbabilityInterval)
 			// Only load probabilities if this processor doesn't hold the leader lock
 			if !p.isLeader() {
 				p.loadProbabilities()
@@ -253,14 +410,22 @@ func (p *processor) isLeader() bool {
 
 func (p *processor) setLeader(isLeader bool) {
 	p.Store(isLeader)
+	if isLeader {
+		p.leaderGauge.Update(1)
+	} else {
+		p.leaderGauge.Update(0)
+	}
 }
 
-// addJitter sleeps for a random amount of time. Without jitter, if the host holding the leader
-// lock were to die, then all other collectors can potentially wait for a full cycle before
-// trying to acquire the lock. With jitter, we can reduce the average amount of time before a
-// new leader is elected. Furthermore, jitter can be used to spread out read load on storage.
-func addJitter(jitterAmount time.Duration) {
-	randomTime := (jitterAmount / 2) + time.Duration(rand.Int63n(int64(jitterAmount/2)))
+// sleepJitter sleeps for a random amount of time in [jitterAmount/2, jitterAmount]. Without
+// it, if the host holding the leader lock were to die, all other collectors could restart
+// and race for the lock in lockstep; jitter spreads out that first attempt (and, for the
+// same reason, the read load the calculation/update-probabilities loops put on storage).
+func sleepJitter(jitterAmount time.Duration) {
+	if jitterAmount <= 0 {
+		return
+	}
+	randomTime := (jitterAmount / 2) + time.Duration(rand.Int63n(int64(jitterAmount/2)+1))
 	time.Sleep(randomTime)
 }
 
@@ -268,14 +433,21 @@ func (p *processor) runCalculationLoop() {
 	lastCheckedTime := time.Now().Add(p.Delay * -1)
 	p.initializeThroughput(lastCheckedTime)
 	// NB: the first tick will be slightly delayed by the initializeThroughput call.
-	ticker := time.NewTicker(p.CalculationInterval)
+	ticker := p.newIntervalTicker(p.CalculationInterval, p.Jitter)
+	p.Lock()
+	p.calculationTicker = ticker
+	p.Unlock()
 	defer ticker.Stop()
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
+			p.RLock()
+			calculationInterval := p.CalculationInterval
+			p.RUnlock()
+			ticker.Reset(calculationInterval)
 			endTime := time.Now().Add(p.Delay * -1)
 			startTime := lastCheckedTime
-			throughput, err := p.storage.GetThroughput(startTime, endTime)
+			throughput, err := p.getThroughput(startTime, endTime)
 			if err != nil {
 				p.logger.Error(getThroughputErrMsg, zap.Error(err))
 				break
@@ -318,11 +490,30 @@ func (p *processor) saveProbabilitiesAndQPS() {
 	p.RLock()
 	defer p.RUnlock()
 	if err := p.storage.InsertProbabilitiesAndQPS(p.hostname, p.probabilities, p.qps); err != nil {
+		p.probabilitiesSaveErrorCounter.Inc(1)
 		p.logger.Warn("Could not save probabilities", zap.Error(err))
+		return
 	}
+	p.probabilitiesSavedCounter.Inc(1)
+}
+
+// getThroughput fetches throughput from storage, recording success/failure counters and
+// fetch latency around the call.
+func (p *processor) getThroughput(startTime, endTime time.Time) ([]*samplingstore.Throughput, error) {
+	start := time.Now()
+	throughput, err := p.storage.GetThroughput(startTime, endTime)
+	p.throughputFetchLatency.Record(time.Since(start))
+	if err != nil {
+		p.throughputFetchFailureCounter.Inc(1)
+		return nil, err
+	}
+	p.throughputFetchSuccessCounter.Inc(1)
+	return throughput, nil
 }
 
 func (p *processor) prependThroughputBucket(bucket *throughputBucket) {
+	p.Lock()
+	defer p.Unlock()
 	p.throughputs = append([]*throughputBucket{bucket}, p.throughputs...)
 	if len(p.throughputs) > p.buckets {
 		p.throughputs = p.throughputs[0:p.buckets]
@@ -349,9 +540,14 @@ func (p *processor) aggregateThroughput(throughputs []*samplingstore.Throughput)
 }
 
 func (p *processor) initializeThroughput(endTime time.Time) {
-	for i := 0; i < p.buckets; i++ {
-		startTime := endTime.Add(p.CalculationInterval * -1)
-		throughput, err := p.storage.GetThroughput(startTime, endTime)
+	p.RLock()
+	buckets := p.buckets
+	calculationInterval := p.CalculationInterval
+	p.RUnlock()
+
+	for i := 0; i < buckets; i++ {
+		startTime := endTime.Add(calculationInterval * -1)
+		throughput, err := p.getThroughput(startTime, endTime)
 		if err != nil && p.logger != nil {
 			p.logger.Error(getThroughputErrMsg, zap.Error(err))
 			return
@@ -360,11 +556,13 @@ func (p *processor) initializeThroughput(endTime time.Time) {
 			return
 		}
 		aggregatedThroughput := p.aggregateThroughput(throughput)
+		p.Lock()
 		p.throughputs = append(p.throughputs, &throughputBucket{
 			throughput: aggregatedThroughput,
-			interval:   p.CalculationInterval,
+			interval:   calculationInterval,
 			endTime:    endTime,
 		})
+		p.Unlock()
 		endTime = startTime
 	}
 }
@@ -374,6 +572,8 @@ type serviceOperationQPS map[string]map[string][]float64
 func (p *processor) generateOperationQPS() serviceOperationQPS {
 	// TODO previous qps buckets have already been calculated, just need to calculate latest batch and append them
 	// where necessary and throw out the oldest batch. Edge case #buckets < p.buckets, then we shouldn't throw out
+	p.RLock()
+	defer p.RUnlock()
 	qps := make(serviceOperationQPS)
 	for _, bucket := range p.throughputs {
 		for svc, operations := range bucket.throughput {
@@ -396,20 +596,6 @@ func calculateQPS(count int64, interval time.Duration) float64 {
 	return float64(count) / seconds
 }
 
-// calculateWeightedQPS calculates the weighted qps of the slice allQPS where weights are biased towards more recent
-// qps. This function assumes that the most recent qps is at the head of the slice.
-func (p *processor) calculateWeightedQPS(allQPS []float64) float64 {
-	if len(allQPS) == 0 {
-		return 0
-	}
-	weights := p.weightsCache.getWeights(len(allQPS))
-	var qps float64
-	for i := 0; i < len(allQPS); i++ {
-		qps += allQPS[i] * weights[i]
-	}
-	return qps
-}
-
 func (p *processor) prependServiceCache() {
 	p.serviceCache = append([]samplingCache{make(samplingCache)}, p.serviceCache...)
 	if len(p.serviceCache) > serviceCacheSize {
@@ -424,33 +610,83 @@ func (p *processor) calculateProbabilitiesAndQPS() (samplingstore.ServiceOperati
 	svcOpQPS := p.generateOperationQPS()
 	totalOperations := int64(0)
 	for svc, opQPS := range svcOpQPS {
-		if _, ok := retProbabilities[svc]; !ok {
-			retProbabilities[svc] = make(map[string]float64)
-		}
 		if _, ok := retQPS[svc]; !ok {
 			retQPS[svc] = make(map[string]float64)
 		}
 		for op, qps := range opQPS {
 			totalOperations++
-			avgQPS := p.calculateWeightedQPS(qps)
-			retQPS[svc][op] = avgQPS
-			retProbabilities[svc][op] = p.calculateProbability(svc, op, avgQPS)
+			retQPS[svc][op] = p.qpsCalculator.Calculate(svc, op, qps)
 		}
 	}
 	p.operationsCalculatedGauge.Update(totalOperations)
+
+	// Only recalculate the probability of operations the scheduler deems due this tick;
+	// the rest keep their previously calculated probability. This bounds per-tick work on
+	// deployments with very large numbers of operations. Every operation is eventually
+	// re-examined only when MaxRecalculationStaleness is positive; with it at 0, operations
+	// near target can be skipped indefinitely (see priorityQueueScheduler).
+	due := make(map[string]struct{})
+	for _, op := range p.recalculationScheduler.Schedule(retQPS, p.MaxOperationsPerInterval) {
+		due[operationKey(op.Service, op.Operation)] = struct{}{}
+	}
+
+	p.RLock()
+	previousProbabilities := p.probabilities
+	p.RUnlock()
+
+	for svc, opQPS := range retQPS {
+		retProbabilities[svc] = make(map[string]float64)
+		for op, avgQPS := range opQPS {
+			if _, isDue := due[operationKey(svc, op)]; !isDue {
+				if previousProbability, ok := previousProbabilities[svc][op]; ok {
+					retProbabilities[svc][op] = previousProbability
+					continue
+				}
+			}
+			retProbabilities[svc][op] = p.calculateProbability(svc, op, avgQPS)
+		}
+	}
+	p.emitServiceOperationMetrics(retProbabilities, retQPS)
 	return retProbabilities, retQPS
 }
 
+// emitServiceOperationMetrics emits tagged service_operation_probability and
+// service_operation_qps gauges for each calculated service+operation pair, up to
+// MaxServiceOperationMetrics pairs. Operations beyond the cap are counted in the
+// omitted_operations summary gauge instead of being emitted individually, to bound the
+// cardinality these gauges add to the metrics backend.
+func (p *processor) emitServiceOperationMetrics(probabilities samplingstore.ServiceOperationProbabilities, qps samplingstore.ServiceOperationQPS) {
+	limit := p.MaxServiceOperationMetrics
+	emitted := 0
+	var omitted int64
+	for svc, opProbabilities := range probabilities {
+		for op, probability := range opProbabilities {
+			if limit > 0 && emitted >= limit {
+				omitted++
+				continue
+			}
+			tags := map[string]string{"service": svc, "operation": op}
+			// Gauges only carry int64 values; probabilities and qps are scaled up to
+			// preserve precision.
+			p.metricsFactory.Gauge("service_operation_probability", tags).Update(int64(probability * metricsFloatScale))
+			p.metricsFactory.Gauge("service_operation_qps", tags).Update(int64(qps[svc][op] * metricsFloatScale))
+			emitted++
+		}
+	}
+	p.omittedOperationsGauge.Update(omitted)
+}
+
 func (p *processor) calculateProbability(service, operation string, qps float64) float64 {
-	oldProbability := p.DefaultSamplingProbability
 	// TODO: is this loop overly expensive?
 	p.RLock()
+	oldProbability := p.DefaultSamplingProbability
 	if opProbabilities, ok := p.probabilities[service]; ok {
 		if probability, ok := opProbabilities[operation]; ok {
 			oldProbability = probability
 		}
 	}
 	latestThroughput := p.throughputs[0].throughput
+	minSamplingProbability := p.MinSamplingProbability
 	p.RUnlock()
 
 	usingAdaptiveSampling := p.usingAdaptiveSampling(oldProbability, service, operation, latestThroughput)
@@ -473,7 +709,11 @@ func (p *processor) calculateProbability(service, operation string, qps float64)
 	} else {
 		newProbability = p.probabilityCalculator.Calculate(targetQPS, qps, oldProbability)
 	}
-	return math.Min(maxSamplingProbability, math.Max(p.MinSamplingProbability, newProbability))
+	newProbability = math.Min(maxSamplingProbability, math.Max(minSamplingProbability, newProbability))
+	if !floatEquals(oldProbability, 0) {
+		p.probabilityChangeRatioHistogram.Record(newProbability / oldProbability)
+	}
+	return newProbability
 }
 
 func combineProbabilities(p1 map[string]struct{}, p2 map[string]struct{}) map[string]struct{} {
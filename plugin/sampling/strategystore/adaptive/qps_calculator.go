@@ -0,0 +1,98 @@
+package adaptive
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/uber-go/atomic"
+)
+
+// QPSCalculator derives a single smoothed qps estimate for a service+operation from the
+// per-bucket qps values collected within the lookback window (most recent bucket first).
+// It is invoked once per service+operation each time the leader recalculates probabilities:
+// on every calculation tick, and when Reconfigure changes the target QPS.
+type QPSCalculator interface {
+	Calculate(service, operation string, qps []float64) float64
+}
+
+// weightedQPSCalculator is the original QPSCalculator: a weighted average over the
+// discrete lookback buckets, biased towards more recent qps via weightsCache.
+type weightedQPSCalculator struct {
+	weightsCache *weightsCache
+}
+
+func newWeightedQPSCalculator(weightsCache *weightsCache) *weightedQPSCalculator {
+	return &weightedQPSCalculator{weightsCache: weightsCache}
+}
+
+// Calculate calculates the weighted qps of the slice qps where weights are biased towards
+// more recent qps. This function assumes that the most recent qps is at the head of the slice.
+func (c *weightedQPSCalculator) Calculate(_, _ string, qps []float64) float64 {
+	if len(qps) == 0 {
+		return 0
+	}
+	weights := c.weightsCache.getWeights(len(qps))
+	var weighted float64
+	for i := 0; i < len(qps); i++ {
+		weighted += qps[i] * weights[i]
+	}
+	return weighted
+}
+
+// EWMAQPSCalculator smooths qps with an exponentially weighted moving average instead of
+// blending a fixed number of discrete lookback buckets. It reacts more smoothly to changes
+// in traffic and, once warmed, no longer needs LookbackQPSCount buckets kept in memory per
+// operation: a single rate per service+operation is enough.
+//
+// The rate is updated on every call to Calculate as:
+//
+//	rate = alpha*instantRate + (1-alpha)*rate
+//
+// where instantRate is the most recent bucket's qps and alpha is derived from a configured
+// half life: alpha = 1 - exp(-interval/halfLife). An operation seen for the first time
+// initializes its rate to the first observed instant rate.
+type EWMAQPSCalculator struct {
+	alpha float64
+
+	mux   sync.Mutex
+	rates map[string]*atomic.Uint64
+}
+
+// NewEWMAQPSCalculator creates an EWMAQPSCalculator whose smoothing factor is derived from
+// interval (the calculation tick interval) and halfLife (how long it takes a rate change to
+// be half-reflected in the smoothed value).
+func NewEWMAQPSCalculator(interval, halfLife time.Duration) *EWMAQPSCalculator {
+	return &EWMAQPSCalculator{
+		alpha: 1 - math.Exp(-interval.Seconds()/halfLife.Seconds()),
+		rates: make(map[string]*atomic.Uint64),
+	}
+}
+
+// Calculate updates and returns the EWMA-smoothed qps for the given service+operation.
+func (c *EWMAQPSCalculator) Calculate(service, operation string, qps []float64) float64 {
+	if len(qps) == 0 {
+		return 0
+	}
+	instantRate := qps[0]
+	key := service + "\x00" + operation
+
+	c.mux.Lock()
+	rateHolder, ok := c.rates[key]
+	if !ok {
+		rateHolder = atomic.NewUint64(math.Float64bits(instantRate))
+		c.rates[key] = rateHolder
+	}
+	c.mux.Unlock()
+	if !ok {
+		return instantRate
+	}
+
+	for {
+		old := rateHolder.Load()
+		newRate := c.alpha*instantRate + (1-c.alpha)*math.Float64frombits(old)
+		if rateHolder.CAS(old, math.Float64bits(newRate)) {
+			return newRate
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package adaptive
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEWMAQPSCalculator_FirstObservationInitializesRate(t *testing.T) {
+	c := NewEWMAQPSCalculator(10*time.Second, 30*time.Second)
+	if got := c.Calculate("svcA", "op1", []float64{5}); got != 5 {
+		t.Errorf("Calculate() = %v, want 5", got)
+	}
+}
+
+func TestEWMAQPSCalculator_SmoothsTowardsNewInstantRate(t *testing.T) {
+	interval := 10 * time.Second
+	halfLife := 10 * time.Second
+	c := NewEWMAQPSCalculator(interval, halfLife)
+	alpha := 1 - math.Exp(-interval.Seconds()/halfLife.Seconds())
+
+	first := c.Calculate("svcA", "op1", []float64{10})
+	if first != 10 {
+		t.Fatalf("first observation should initialize the rate, got %v", first)
+	}
+	second := c.Calculate("svcA", "op1", []float64{20})
+	want := alpha*20 + (1-alpha)*10
+	if math.Abs(second-want) > 1e-9 {
+		t.Errorf("Calculate() = %v, want %v", second, want)
+	}
+}
+
+func TestEWMAQPSCalculator_EmptyQPSReturnsZero(t *testing.T) {
+	c := NewEWMAQPSCalculator(time.Second, time.Second)
+	if got := c.Calculate("svcA", "op1", nil); got != 0 {
+		t.Errorf("Calculate() = %v, want 0", got)
+	}
+}
+
+func TestEWMAQPSCalculator_TracksServiceOperationIndependently(t *testing.T) {
+	c := NewEWMAQPSCalculator(time.Second, time.Second)
+	c.Calculate("svcA", "op1", []float64{5})
+	if got := c.Calculate("svcB", "op1", []float64{50}); got != 50 {
+		t.Errorf("a different service+operation pair should start from its own instant rate, got %v", got)
+	}
+}
@@ -0,0 +1,162 @@
+package adaptive
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jaegertracing/jaeger/storage/samplingstore"
+)
+
+// operationPriority is the unit of work a RecalculationScheduler hands back: a single
+// service+operation pair that is due for recalculation this tick.
+type operationPriority struct {
+	Service        string
+	Operation      string
+	QPS            float64
+	lastCalculated time.Time
+
+	priority float64
+	index    int // maintained by container/heap
+}
+
+// RecalculationScheduler decides, for a given calculation tick, which service+operation
+// pairs are due for a fresh probability calculation. This bounds the per-tick work of
+// calculateProbabilitiesAndQPS on deployments with very large numbers of operations, while
+// still making progress on every operation over time. Alternative policies (e.g.
+// round-robin, throughput-weighted) can be plugged in by implementing this interface.
+type RecalculationScheduler interface {
+	// Schedule returns, out of qps, at most budget operations to recalculate this tick, most
+	// in need of recalculation first. A budget <= 0 means unbounded: every operation is due.
+	Schedule(qps samplingstore.ServiceOperationQPS, budget int) []operationPriority
+}
+
+// priorityQueueScheduler is the default RecalculationScheduler. It scores each operation by
+// how far its qps is from the target, normalized by the target, so the operations furthest
+// out of target are recalculated first. When staleness is positive, every operation's
+// priority is also boosted by the time since its last recalculation divided by staleness,
+// so operations sitting right at target are still periodically re-examined instead of
+// starving behind chronically out-of-target ones. When staleness is 0 there is no boost.
+type priorityQueueScheduler struct {
+	targetQPS func() float64
+	staleness time.Duration
+
+	// mu guards lastCalculated, since Schedule can be called concurrently: once from
+	// runCalculationLoop's ticker and once from a goroutine calling Processor.Reconfigure.
+	mu             sync.Mutex
+	lastCalculated map[string]time.Time
+}
+
+// newPriorityQueueScheduler creates a priorityQueueScheduler. targetQPS is called on every
+// Schedule to read the current target, so that Processor.Reconfigure changes are picked up
+// without reconstructing the scheduler.
+func newPriorityQueueScheduler(targetQPS func() float64, staleness time.Duration) *priorityQueueScheduler {
+	return &priorityQueueScheduler{
+		targetQPS:      targetQPS,
+		staleness:      staleness,
+		lastCalculated: make(map[string]time.Time),
+	}
+}
+
+func operationKey(service, operation string) string {
+	return service + "\x00" + operation
+}
+
+func (s *priorityQueueScheduler) Schedule(qps samplingstore.ServiceOperationQPS, budget int) []operationPriority {
+	now := time.Now()
+	target := s.targetQPS()
+
+	s.mu.Lock()
+	previous := s.lastCalculated
+	s.mu.Unlock()
+
+	// updated becomes the new lastCalculated: it holds an entry for every operation observed
+	// this tick (so a stable operation keeps accumulating staleness even when it never wins
+	// the priority comparison) and drops operations that are no longer present, so the map
+	// doesn't grow unbounded as the service graph changes.
+	updated := make(map[string]time.Time, len(qps))
+	pq := make(operationPriorityQueue, 0, len(qps))
+	for svc, opQPS := range qps {
+		for op, q := range opQPS {
+			key := operationKey(svc, op)
+			last, ok := previous[key]
+			if !ok {
+				last = now
+			}
+			updated[key] = last
+			pq = append(pq, &operationPriority{
+				Service:        svc,
+				Operation:      op,
+				QPS:            q,
+				lastCalculated: last,
+				priority:       s.priority(q, target, now.Sub(last)),
+			})
+		}
+	}
+	heap.Init(&pq)
+
+	if budget <= 0 || budget > pq.Len() {
+		budget = pq.Len()
+	}
+	scheduled := make([]operationPriority, 0, budget)
+	for i := 0; i < budget; i++ {
+		op := heap.Pop(&pq).(*operationPriority)
+		updated[operationKey(op.Service, op.Operation)] = now
+		scheduled = append(scheduled, *op)
+	}
+
+	s.mu.Lock()
+	s.lastCalculated = updated
+	s.mu.Unlock()
+
+	return scheduled
+}
+
+// priority combines how far qps is from target with how stale the operation's last
+// calculation is, so operations are recalculated either because they're out of target or
+// because they haven't been looked at in a while.
+func (s *priorityQueueScheduler) priority(qps, target float64, sinceLastCalculated time.Duration) float64 {
+	var distance float64
+	if target != 0 {
+		distance = math.Abs(qps-target) / target
+	}
+	var stalenessBoost float64
+	if s.staleness > 0 {
+		stalenessBoost = float64(sinceLastCalculated) / float64(s.staleness)
+	}
+	return distance + stalenessBoost
+}
+
+// operationPriorityQueue is a container/heap.Interface max-heap over operationPriority,
+// ordered so the highest-priority (most out-of-target or most stale) operation is popped
+// first.
+type operationPriorityQueue []*operationPriority
+
+func (q operationPriorityQueue) Len() int { return len(q) }
+
+func (q operationPriorityQueue) Less(i, j int) bool {
+	return q[i].priority > q[j].priority
+}
+
+func (q operationPriorityQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *operationPriorityQueue) Push(x interface{}) {
+	item := x.(*operationPriority)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *operationPriorityQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*q = old[:n-1]
+	return item
+}
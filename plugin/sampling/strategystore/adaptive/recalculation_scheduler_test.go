@@ -0,0 +1,78 @@
+package adaptive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jaegertracing/jaeger/storage/samplingstore"
+)
+
+func constantTargetQPS(qps float64) func() float64 {
+	return func() float64 { return qps }
+}
+
+// TestPriorityQueueScheduler_StableOperationEventuallyDue verifies that an operation sitting
+// exactly at target QPS -- and therefore never winning the distance-based priority
+// comparison -- still accumulates staleness tick over tick and eventually gets scheduled,
+// instead of being reset to "just calculated" every time it's skipped.
+func TestPriorityQueueScheduler_StableOperationEventuallyDue(t *testing.T) {
+	s := newPriorityQueueScheduler(constantTargetQPS(100), 0)
+
+	qps := samplingstore.ServiceOperationQPS{
+		"svcA": {"stable": 100, "hot": 1000},
+	}
+
+	for i := 0; i < 5; i++ {
+		scheduled := s.Schedule(qps, 1)
+		if len(scheduled) != 1 || scheduled[0].Operation != "hot" {
+			t.Fatalf("tick %d: expected only the out-of-target operation to be scheduled, got %+v", i, scheduled)
+		}
+		if _, ok := s.lastCalculated[operationKey("svcA", "stable")]; !ok {
+			t.Fatalf("tick %d: stable operation should still be tracked even though it wasn't scheduled", i)
+		}
+	}
+
+	// After several ticks with a non-zero staleness window, the stable operation's growing
+	// staleness boost should eventually outweigh the hot operation's (constant) distance and
+	// get it scheduled, even though "hot" keeps winning every individual comparison along the
+	// way (its own staleness resets to zero each time it's recalculated).
+	s2 := newPriorityQueueScheduler(constantTargetQPS(100), 2*time.Millisecond)
+	s2.Schedule(qps, 1) // tick 1: "hot" wins (distance 9 vs 0); both operations are now tracked.
+	time.Sleep(50 * time.Millisecond)
+	scheduled := s2.Schedule(qps, 1) // tick 2: both aged equally, "hot"'s distance still wins, resetting its own staleness.
+	if len(scheduled) != 1 || scheduled[0].Operation != "hot" {
+		t.Fatalf("tick 2: expected hot to still win on distance, got %+v", scheduled)
+	}
+	scheduled = s2.Schedule(qps, 1) // tick 3: "hot" was just reset, "stable" has kept aging since tick 1 -- it's now due.
+	if len(scheduled) != 1 || scheduled[0].Operation != "stable" {
+		t.Fatalf("tick 3: expected the long-stale stable operation to finally be scheduled, got %+v", scheduled)
+	}
+}
+
+// TestPriorityQueueScheduler_PrunesRemovedOperations verifies that an operation no longer
+// present in qps is dropped from lastCalculated instead of accumulating forever.
+func TestPriorityQueueScheduler_PrunesRemovedOperations(t *testing.T) {
+	s := newPriorityQueueScheduler(constantTargetQPS(100), 0)
+
+	s.Schedule(samplingstore.ServiceOperationQPS{"svcA": {"op1": 100, "op2": 100}}, 0)
+	if len(s.lastCalculated) != 2 {
+		t.Fatalf("expected 2 tracked operations, got %d", len(s.lastCalculated))
+	}
+
+	s.Schedule(samplingstore.ServiceOperationQPS{"svcA": {"op1": 100}}, 0)
+	if len(s.lastCalculated) != 1 {
+		t.Fatalf("expected op2 to be pruned after it stopped appearing, got %d tracked operations", len(s.lastCalculated))
+	}
+	if _, ok := s.lastCalculated[operationKey("svcA", "op2")]; ok {
+		t.Fatalf("op2 should have been pruned")
+	}
+}
+
+func TestPriorityQueueScheduler_ZeroBudgetSchedulesEverything(t *testing.T) {
+	s := newPriorityQueueScheduler(constantTargetQPS(100), 0)
+	qps := samplingstore.ServiceOperationQPS{"svcA": {"op1": 50, "op2": 200}}
+	scheduled := s.Schedule(qps, 0)
+	if len(scheduled) != 2 {
+		t.Fatalf("budget <= 0 should schedule every operation, got %d", len(scheduled))
+	}
+}
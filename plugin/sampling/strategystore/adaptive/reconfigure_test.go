@@ -0,0 +1,128 @@
+package adaptive
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testMutableOpts is a minimal stand-in for the processor's DynamicOpts-shaped Mutable
+// field, letting these tests construct a processor without depending on the real
+// (out-of-tree) implementation.
+type testMutableOpts struct {
+	targetQPS               float64
+	qpsEquivalenceThreshold float64
+}
+
+func (o *testMutableOpts) GetTargetQPS() float64              { return o.targetQPS }
+func (o *testMutableOpts) SetTargetQPS(qps float64)            { o.targetQPS = qps }
+func (o *testMutableOpts) GetQPSEquivalenceThreshold() float64 { return o.qpsEquivalenceThreshold }
+
+// fakeTicker records the intervals it's Reset to, so tests can assert Reconfigure applies a
+// new CalculationInterval live instead of only on the next process restart.
+type fakeTicker struct {
+	ch         chan time.Time
+	resetCalls []time.Duration
+}
+
+func (f *fakeTicker) C() <-chan time.Time          { return f.ch }
+func (f *fakeTicker) Reset(interval time.Duration) { f.resetCalls = append(f.resetCalls, interval) }
+func (f *fakeTicker) Stop()                        {}
+
+func newTestProcessor() *processor {
+	return &processor{
+		ProcessorConfig: ProcessorConfig{
+			CalculationInterval:        time.Second,
+			LookbackInterval:           10 * time.Second,
+			MinSamplingProbability:     0.001,
+			DefaultSamplingProbability: 0.05,
+			Mutable:                    &testMutableOpts{targetQPS: 10},
+		},
+		buckets: 10,
+		logger:  zap.NewNop(),
+	}
+}
+
+func TestReconfigure_RejectsNonPositiveIntervals(t *testing.T) {
+	p := newTestProcessor()
+	zero := time.Duration(0)
+	err := p.Reconfigure(ReconfigureArgs{NewCalculationInterval: &zero})
+	if err != errNonZeroIntervals {
+		t.Fatalf("Reconfigure() err = %v, want %v", err, errNonZeroIntervals)
+	}
+	if p.CalculationInterval != time.Second {
+		t.Fatalf("CalculationInterval should be unchanged after a rejected Reconfigure, got %v", p.CalculationInterval)
+	}
+}
+
+func TestReconfigure_RejectsLookbackShorterThanCalculation(t *testing.T) {
+	p := newTestProcessor()
+	tooLong := 20 * time.Second
+	err := p.Reconfigure(ReconfigureArgs{NewCalculationInterval: &tooLong})
+	if err != errIntervals {
+		t.Fatalf("Reconfigure() err = %v, want %v", err, errIntervals)
+	}
+}
+
+func TestReconfigure_RecomputesBucketsAndTrimsThroughputs(t *testing.T) {
+	p := newTestProcessor()
+	for i := 0; i < 10; i++ {
+		p.throughputs = append(p.throughputs, &throughputBucket{})
+	}
+	newLookback := 5 * time.Second
+	if err := p.Reconfigure(ReconfigureArgs{NewLookbackInterval: &newLookback}); err != nil {
+		t.Fatalf("Reconfigure() err = %v, want nil", err)
+	}
+	if p.buckets != 5 {
+		t.Errorf("buckets = %d, want 5", p.buckets)
+	}
+	if len(p.throughputs) != 5 {
+		t.Errorf("len(throughputs) = %d, want 5", len(p.throughputs))
+	}
+}
+
+func TestReconfigure_ResetsCalculationTickerOnIntervalChange(t *testing.T) {
+	p := newTestProcessor()
+	ticker := &fakeTicker{ch: make(chan time.Time)}
+	p.calculationTicker = ticker
+
+	newInterval := 2 * time.Second
+	if err := p.Reconfigure(ReconfigureArgs{NewCalculationInterval: &newInterval}); err != nil {
+		t.Fatalf("Reconfigure() err = %v, want nil", err)
+	}
+	if len(ticker.resetCalls) != 1 || ticker.resetCalls[0] != newInterval {
+		t.Errorf("calculationTicker.Reset calls = %v, want a single call with %v", ticker.resetCalls, newInterval)
+	}
+}
+
+func TestReconfigure_DoesNotResetTickerWhenIntervalUnchanged(t *testing.T) {
+	p := newTestProcessor()
+	ticker := &fakeTicker{ch: make(chan time.Time)}
+	p.calculationTicker = ticker
+
+	newMin := 0.002
+	if err := p.Reconfigure(ReconfigureArgs{NewMinSamplingProbability: &newMin}); err != nil {
+		t.Fatalf("Reconfigure() err = %v, want nil", err)
+	}
+	if len(ticker.resetCalls) != 0 {
+		t.Errorf("calculationTicker.Reset calls = %v, want none", ticker.resetCalls)
+	}
+}
+
+// TestReconfigure_SkipsImmediateRecalculationWithoutThroughput guards against the
+// panic calculateProbability's p.throughputs[0] dereference would otherwise cause: a target
+// QPS change arriving on the leader before any throughput bucket has been recorded (e.g. a
+// fresh deployment with no traffic yet) must not trigger the immediate recalculation.
+func TestReconfigure_SkipsImmediateRecalculationWithoutThroughput(t *testing.T) {
+	p := newTestProcessor()
+	p.Store(true) // mark this processor as leader without needing a leaderGauge
+
+	newTargetQPS := 42.0
+	if err := p.Reconfigure(ReconfigureArgs{NewTargetQPS: &newTargetQPS}); err != nil {
+		t.Fatalf("Reconfigure() err = %v, want nil", err)
+	}
+	if got := p.Mutable.GetTargetQPS(); got != newTargetQPS {
+		t.Errorf("Mutable.GetTargetQPS() = %v, want %v", got, newTargetQPS)
+	}
+}
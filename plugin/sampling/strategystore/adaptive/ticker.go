@@ -0,0 +1,123 @@
+package adaptive
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Ticker is an abstraction over a periodic clock signal, analogous to time.Ticker, that
+// lets the calculation, update-probabilities, and acquire-lock loops choose between
+// wall-clock aligned and unaligned firing without duplicating the jitter/reset logic.
+type Ticker interface {
+	// C returns the channel on which ticks are delivered.
+	C() <-chan time.Time
+
+	// Reset restarts the ticker so it next fires for the given interval.
+	Reset(interval time.Duration)
+
+	// Stop stops the ticker. Once stopped, no more ticks are delivered.
+	Stop()
+}
+
+// AlignedTicker fires on wall-clock boundaries derived from startTime (e.g. every
+// interval since startTime.Truncate(interval)), with an added random jitter. Aligning
+// every collector replica to the same boundaries avoids the clock drift that a plain
+// time.Ticker accumulates, while the independent per-replica jitter still spreads the
+// resulting reads across the throughput store instead of letting them stampede together.
+// Each delay is computed for one boundary only, so the owner calls Reset after every tick
+// to move on to the next boundary.
+type AlignedTicker struct {
+	startTime time.Time
+	interval  time.Duration
+	jitter    time.Duration
+	ticker    *time.Ticker
+}
+
+// NewAlignedTicker creates an AlignedTicker and starts it ticking towards the next
+// wall-clock boundary after the current time.
+func NewAlignedTicker(startTime time.Time, interval, jitter time.Duration) *AlignedTicker {
+	t := &AlignedTicker{
+		startTime: startTime,
+		interval:  interval,
+		jitter:    jitter,
+	}
+	t.ticker = time.NewTicker(t.nextDelay())
+	return t
+}
+
+func (t *AlignedTicker) nextDelay() time.Duration {
+	return t.nextDelayAt(time.Now())
+}
+
+// nextDelayAt computes the delay until the next aligned boundary after now, split out from
+// nextDelay so the alignment math can be unit tested without depending on the wall clock.
+func (t *AlignedTicker) nextDelayAt(now time.Time) time.Duration {
+	delay := t.interval - (now.Sub(t.startTime) % t.interval)
+	if t.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(t.jitter)))
+	}
+	return delay
+}
+
+func (t *AlignedTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *AlignedTicker) Reset(interval time.Duration) {
+	t.interval = interval
+	t.ticker.Reset(t.nextDelay())
+}
+
+func (t *AlignedTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// UnalignedTicker fires every interval plus a random jitter, independent of wall-clock
+// boundaries. This is the drop-in equivalent of the plain time.Ticker the loops used
+// before, kept around for operators who don't want aligned execution.
+type UnalignedTicker struct {
+	interval time.Duration
+	jitter   time.Duration
+	ticker   *time.Ticker
+}
+
+// NewUnalignedTicker creates an UnalignedTicker and starts it ticking.
+func NewUnalignedTicker(interval, jitter time.Duration) *UnalignedTicker {
+	t := &UnalignedTicker{
+		interval: interval,
+		jitter:   jitter,
+	}
+	t.ticker = time.NewTicker(t.nextDelay())
+	return t
+}
+
+func (t *UnalignedTicker) nextDelay() time.Duration {
+	delay := t.interval
+	if t.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(t.jitter)))
+	}
+	return delay
+}
+
+func (t *UnalignedTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *UnalignedTicker) Reset(interval time.Duration) {
+	t.interval = interval
+	t.ticker.Reset(t.nextDelay())
+}
+
+func (t *UnalignedTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// newIntervalTicker builds the Ticker implementation selected by RoundInterval: an
+// AlignedTicker when the operator wants replicas to wake up on shared wall-clock
+// boundaries, or an UnalignedTicker otherwise.
+func (p *processor) newIntervalTicker(interval, jitter time.Duration) Ticker {
+	if p.RoundInterval {
+		return NewAlignedTicker(time.Now().Truncate(interval), interval, jitter)
+	}
+	return NewUnalignedTicker(interval, jitter)
+}
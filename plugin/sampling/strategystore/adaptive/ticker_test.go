@@ -0,0 +1,66 @@
+package adaptive
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlignedTicker_NextDelayAlignsToBoundary(t *testing.T) {
+	interval := 10 * time.Second
+	startTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ticker := &AlignedTicker{startTime: startTime, interval: interval}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Duration
+	}{
+		{"exactly on boundary", startTime, interval},
+		{"just after boundary", startTime.Add(3 * time.Second), 7 * time.Second},
+		{"one boundary later", startTime.Add(23 * time.Second), 7 * time.Second},
+		{"just before next boundary", startTime.Add(9999 * time.Millisecond), time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ticker.nextDelayAt(tt.now); got != tt.want {
+				t.Errorf("nextDelayAt(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAlignedTicker_ReplicasShareBoundaries verifies that two AlignedTickers constructed
+// independently, moments apart, but truncated to the same interval boundary the way
+// newIntervalTicker does, land on the same wall-clock grid instead of drifting relative to
+// whichever instant each process happened to start at.
+func TestAlignedTicker_ReplicasShareBoundaries(t *testing.T) {
+	interval := 10 * time.Second
+	replicaAStart := time.Date(2020, 1, 1, 0, 0, 3, 0, time.UTC)
+	replicaBStart := time.Date(2020, 1, 1, 0, 0, 7, 0, time.UTC)
+
+	a := &AlignedTicker{startTime: replicaAStart.Truncate(interval), interval: interval}
+	b := &AlignedTicker{startTime: replicaBStart.Truncate(interval), interval: interval}
+
+	observeAt := time.Date(2020, 1, 1, 0, 0, 25, 0, time.UTC)
+	if a.nextDelayAt(observeAt) != b.nextDelayAt(observeAt) {
+		t.Errorf("replicas starting at different moments should converge on the same boundary: a=%v b=%v",
+			a.nextDelayAt(observeAt), b.nextDelayAt(observeAt))
+	}
+}
+
+func TestUnalignedTicker_NextDelayWithoutJitter(t *testing.T) {
+	ticker := &UnalignedTicker{interval: 5 * time.Second}
+	if got := ticker.nextDelay(); got != 5*time.Second {
+		t.Errorf("nextDelay() = %v, want %v", got, 5*time.Second)
+	}
+}
+
+func TestUnalignedTicker_NextDelayWithJitterIsBounded(t *testing.T) {
+	ticker := &UnalignedTicker{interval: 5 * time.Second, jitter: 2 * time.Second}
+	for i := 0; i < 100; i++ {
+		got := ticker.nextDelay()
+		if got < 5*time.Second || got >= 7*time.Second {
+			t.Fatalf("nextDelay() = %v, want in [5s, 7s)", got)
+		}
+	}
+}